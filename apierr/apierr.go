@@ -0,0 +1,126 @@
+// Package apierr provides a small set of typed error markers, modeled on
+// docker's own errdefs package, so HTTP handlers can map an error to a
+// status code without string-matching err.Error().
+package apierr
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrNotFound is implemented by errors that represent a missing resource.
+type ErrNotFound interface {
+	error
+	NotFound()
+}
+
+// ErrConflict is implemented by errors that represent a conflict with
+// the current state of a resource.
+type ErrConflict interface {
+	error
+	Conflict()
+}
+
+// ErrInvalidParameter is implemented by errors caused by bad caller
+// input, as opposed to anything wrong with the resource itself.
+type ErrInvalidParameter interface {
+	error
+	InvalidParameter()
+}
+
+// ErrUnavailable is implemented by errors caused by a dependency (the
+// docker daemon, most often here) being unreachable.
+type ErrUnavailable interface {
+	error
+	Unavailable()
+}
+
+type withNotFound struct{ cause error }
+
+func (e withNotFound) Error() string { return e.cause.Error() }
+func (e withNotFound) Unwrap() error { return e.cause }
+func (e withNotFound) NotFound()     {}
+
+// NotFound wraps err so it satisfies ErrNotFound.
+func NotFound(cause error) error { return withNotFound{cause} }
+
+type withConflict struct{ cause error }
+
+func (e withConflict) Error() string { return e.cause.Error() }
+func (e withConflict) Unwrap() error { return e.cause }
+func (e withConflict) Conflict()     {}
+
+// Conflict wraps err so it satisfies ErrConflict.
+func Conflict(cause error) error { return withConflict{cause} }
+
+type withInvalidParameter struct{ cause error }
+
+func (e withInvalidParameter) Error() string     { return e.cause.Error() }
+func (e withInvalidParameter) Unwrap() error     { return e.cause }
+func (e withInvalidParameter) InvalidParameter() {}
+
+// InvalidParameter wraps err so it satisfies ErrInvalidParameter.
+func InvalidParameter(cause error) error { return withInvalidParameter{cause} }
+
+type withUnavailable struct{ cause error }
+
+func (e withUnavailable) Error() string { return e.cause.Error() }
+func (e withUnavailable) Unwrap() error { return e.cause }
+func (e withUnavailable) Unavailable()  {}
+
+// Unavailable wraps err so it satisfies ErrUnavailable.
+func Unavailable(cause error) error { return withUnavailable{cause} }
+
+// StatusCode maps err to the HTTP status code its most specific typed
+// marker implies, defaulting to 500 for anything untyped.
+func StatusCode(err error) int {
+	switch {
+	case isNotFound(err):
+		return http.StatusNotFound
+	case isConflict(err):
+		return http.StatusConflict
+	case isInvalidParameter(err):
+		return http.StatusBadRequest
+	case isUnavailable(err):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Code returns a short machine-readable string for err, for the "code"
+// field of the JSON error envelope.
+func Code(err error) string {
+	switch {
+	case isNotFound(err):
+		return "not_found"
+	case isConflict(err):
+		return "conflict"
+	case isInvalidParameter(err):
+		return "invalid_parameter"
+	case isUnavailable(err):
+		return "unavailable"
+	default:
+		return "internal"
+	}
+}
+
+func isNotFound(err error) bool {
+	var e ErrNotFound
+	return errors.As(err, &e)
+}
+
+func isConflict(err error) bool {
+	var e ErrConflict
+	return errors.As(err, &e)
+}
+
+func isInvalidParameter(err error) bool {
+	var e ErrInvalidParameter
+	return errors.As(err, &e)
+}
+
+func isUnavailable(err error) bool {
+	var e ErrUnavailable
+	return errors.As(err, &e)
+}
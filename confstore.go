@@ -0,0 +1,214 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Labels used to auto-enroll containers without an explicit POST.
+const (
+	SuperviseLabel          = "supervise.enable"
+	SupervisePolicyLabel    = "supervise.policy"
+	SuperviseUnhealthyLabel = "supervise.on_unhealthy"
+)
+
+// EnrollOptions carries the operator-configurable knobs set at enrollment
+// time, whether via POST form fields or supervise.* labels.
+type EnrollOptions struct {
+	Policy        string
+	MaxRetryCount int
+
+	// OnUnhealthy governs whether a health_status: unhealthy event
+	// triggers the same recreate path as a die. Empty means
+	// OnUnhealthyIgnore.
+	OnUnhealthy        string
+	UnhealthyThreshold int
+}
+
+// Entry is everything the supervisor keeps about one supervised container.
+type Entry struct {
+	// mu guards every field below that's mutated after the entry is
+	// created: the event-handler goroutine, EventSupervisor.resync, and
+	// the restart/stability-window timers can all touch the same entry
+	// concurrently. ConfigStore.mu only protects the map, not what it
+	// hands out.
+	mu sync.Mutex
+
+	Config     *docker.Config
+	HostConfig *docker.HostConfig
+
+	// Networks holds the per-network EndpointConfig (aliases, IPAM
+	// assignment, ...) for every network the container was attached to,
+	// default networks included, keyed by network name.
+	Networks map[string]*docker.EndpointConfig
+
+	// ID is the container's current docker ID, kept around so
+	// ID-only events (destroy, rename) can find the entry back.
+	ID string
+
+	// ReadOnly is true for containers enrolled via SuperviseLabel rather
+	// than an explicit POST. It cannot be removed through the API while
+	// the container still carries the label.
+	ReadOnly bool
+
+	// Policy governs whether/when a died container is recreated. Empty
+	// means RestartAlways, matching the supervisor's original behavior.
+	Policy string
+
+	// MaxRetryCount caps consecutive restart attempts under
+	// RestartOnFailure. Zero means unlimited.
+	MaxRetryCount int
+
+	// Restart is the crash-loop backoff bookkeeping for this entry.
+	Restart RestartState
+
+	// OnUnhealthy and UnhealthyThreshold control whether/when a
+	// health_status: unhealthy event triggers a recreate. See
+	// EnrollOptions.
+	OnUnhealthy        string
+	UnhealthyThreshold int
+
+	// consecutiveUnhealthy counts unhealthy events seen back to back,
+	// reset on a healthy transition. Not persisted; a supervisor
+	// restart re-debounces from zero.
+	consecutiveUnhealthy int
+}
+
+// containerName strips docker's leading "/" from a container's name.
+func containerName(container *docker.Container) string {
+	return strings.TrimPrefix(container.Name, "/")
+}
+
+// ConfigStore tracks the set of containers under supervision and keeps
+// them durable across restarts via a Persister.
+type ConfigStore struct {
+	mu        sync.Mutex
+	entries   map[string]*Entry
+	persister Persister
+}
+
+func NewConfigStore(persister Persister) *ConfigStore {
+	return &ConfigStore{
+		entries:   make(map[string]*Entry),
+		persister: persister,
+	}
+}
+
+// Load repopulates the store from the persister, if one is configured.
+func (s *ConfigStore) Load() error {
+	if s.persister == nil {
+		return nil
+	}
+
+	entries, err := s.persister.Load()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, entry := range entries {
+		s.entries[name] = entry
+	}
+
+	return nil
+}
+
+// Copy returns a snapshot of the current entries, safe to range over
+// without holding the store's lock.
+func (s *ConfigStore) Copy() map[string]*Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]*Entry, len(s.entries))
+	for k, v := range s.entries {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *ConfigStore) Get(name string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[name]
+	return entry, ok
+}
+
+// Add enrolls a container via the explicit HTTP API.
+func (s *ConfigStore) Add(container *docker.Container, opts EnrollOptions) {
+	s.put(containerName(container), entryFrom(container, false, opts))
+}
+
+// AddLabeled enrolls a container discovered via SuperviseLabel. Entries
+// added this way are read-only from the HTTP API's point of view.
+func (s *ConfigStore) AddLabeled(container *docker.Container, opts EnrollOptions) {
+	s.put(containerName(container), entryFrom(container, true, opts))
+}
+
+func entryFrom(container *docker.Container, readOnly bool, opts EnrollOptions) *Entry {
+	return &Entry{
+		Config:             container.Config,
+		HostConfig:         container.HostConfig,
+		Networks:           endpointConfigs(container.NetworkSettings),
+		ID:                 container.ID,
+		ReadOnly:           readOnly,
+		Policy:             opts.Policy,
+		MaxRetryCount:      opts.MaxRetryCount,
+		OnUnhealthy:        opts.OnUnhealthy,
+		UnhealthyThreshold: opts.UnhealthyThreshold,
+	}
+}
+
+// FindByID returns the name and entry currently tracked under container
+// ID, if any. Used by event handling where docker only gives us an ID
+// (e.g. destroy events, where the container can no longer be inspected).
+func (s *ConfigStore) FindByID(id string) (string, *Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, entry := range s.entries {
+		entry.mu.Lock()
+		match := entry.ID == id
+		entry.mu.Unlock()
+		if match {
+			return name, entry, true
+		}
+	}
+	return "", nil, false
+}
+
+func (s *ConfigStore) put(name string, entry *Entry) {
+	s.mu.Lock()
+	s.entries[name] = entry
+	s.mu.Unlock()
+
+	if s.persister != nil {
+		if err := s.persister.Save(name, entry); err != nil {
+			logPersistError("save", name, err)
+		}
+	}
+}
+
+// Remove drops name from supervision unconditionally. Callers that need
+// to protect label-managed entries (e.g. the HTTP DELETE handler) must
+// check Entry.ReadOnly themselves before calling Remove.
+func (s *ConfigStore) Remove(name string) {
+	s.mu.Lock()
+	delete(s.entries, name)
+	s.mu.Unlock()
+
+	if s.persister != nil {
+		if err := s.persister.Delete(name); err != nil {
+			logPersistError("delete", name, err)
+		}
+	}
+}
+
+func logPersistError(op, name string, err error) {
+	log.Printf("[warn] persist %s %s: %v", op, name, err)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/cobjet-docker/docker-supervise/apierr"
+	"github.com/fsouza/go-dockerclient"
+)
+
+// classifyDockerErr wraps a go-dockerclient error in the apierr type that
+// best describes it, so writeError can pick the right status code
+// instead of collapsing every failure into a 400.
+func classifyDockerErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch err.(type) {
+	case *docker.NoSuchContainer:
+		return apierr.NotFound(err)
+	case *docker.ContainerAlreadyRunning:
+		return apierr.Conflict(err)
+	default:
+		// InspectContainer et al. return a bare error for anything from
+		// a malformed response to a refused connection; without a typed
+		// error to distinguish "daemon said no" from "daemon is gone",
+		// treat it as the daemon being unreachable.
+		return apierr.Unavailable(err)
+	}
+}
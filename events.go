@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// eventAction normalizes an APIEvents into the action name we switch on.
+// Recent daemons set Action directly, but for a health check transition
+// it's still the same composite string Status always used --
+// "health_status: unhealthy" -- not a bare "health_status", so it needs
+// splitStatus too. Older daemons (and older go-dockerclient releases
+// that don't decode Action at all) leave Action empty and put the same
+// composite string in Status instead.
+func eventAction(event *docker.APIEvents) string {
+	if event.Action != "" {
+		if action, _ := splitStatus(event.Action); action != "" {
+			return action
+		}
+		return event.Action
+	}
+	if action, _ := splitStatus(event.Status); action != "" {
+		return action
+	}
+	return event.Status
+}
+
+// eventHealthStatus extracts the health state ("healthy", "unhealthy",
+// "starting") from a health_status event, preferring the structured
+// Actor attribute newer daemons provide and falling back to parsing
+// Status for older ones.
+func eventHealthStatus(event *docker.APIEvents) string {
+	if event.Actor.Attributes != nil {
+		if status, ok := event.Actor.Attributes["healthStatus"]; ok {
+			return status
+		}
+	}
+	_, status := splitStatus(event.Status)
+	return status
+}
+
+func splitStatus(status string) (action, detail string) {
+	idx := strings.Index(status, ":")
+	if idx == -1 {
+		return "", ""
+	}
+	return strings.TrimSpace(status[:idx]), strings.TrimSpace(status[idx+1:])
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+func TestEventAction(t *testing.T) {
+	cases := []struct {
+		name  string
+		event docker.APIEvents
+		want  string
+	}{
+		{
+			name:  "bare action",
+			event: docker.APIEvents{Action: "die"},
+			want:  "die",
+		},
+		{
+			name:  "composite health_status action",
+			event: docker.APIEvents{Action: "health_status: unhealthy"},
+			want:  "health_status",
+		},
+		{
+			name:  "action empty, composite status",
+			event: docker.APIEvents{Status: "health_status: unhealthy"},
+			want:  "health_status",
+		},
+		{
+			name:  "action and status both empty",
+			event: docker.APIEvents{},
+			want:  "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := eventAction(&c.event); got != c.want {
+				t.Errorf("eventAction(%+v) = %q, want %q", c.event, got, c.want)
+			}
+		})
+	}
+}
+
+func TestSplitStatus(t *testing.T) {
+	cases := []struct {
+		status     string
+		wantAction string
+		wantDetail string
+	}{
+		{"health_status: unhealthy", "health_status", "unhealthy"},
+		{"die", "", ""},
+		{"", "", ""},
+	}
+
+	for _, c := range cases {
+		action, detail := splitStatus(c.status)
+		if action != c.wantAction || detail != c.wantDetail {
+			t.Errorf("splitStatus(%q) = (%q, %q), want (%q, %q)", c.status, action, detail, c.wantAction, c.wantDetail)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+const (
+	backoffBase = 500 * time.Millisecond
+	backoffCap  = 30 * time.Second
+)
+
+// EventSupervisor owns the docker event listener's lifecycle: it detects
+// the channel closing (daemon restart, dropped hijack, ...), tears down
+// and re-registers the listener with exponential backoff + jitter, and
+// runs a resync after every reconnect so nothing died unnoticed while we
+// were disconnected.
+type EventSupervisor struct {
+	client *docker.Client
+
+	// Since, if non-zero, makes every (re)registered listener replay
+	// events from now minus Since, so a die missed while disconnected is
+	// delivered again; kept as a duration so each reconnect computes its
+	// own "since" relative to now. resync does not use it: it inspects
+	// every supervised container on each reconnect.
+	Since time.Duration
+
+	// Until, if non-zero, bounds the far end of that same window: the
+	// listener is registered for events up to now minus Until instead of
+	// an open-ended live tail. Leave it zero (the default) for the normal
+	// "replay from Since, then keep listening forever" behavior; setting
+	// it turns each reconnect into a bounded catch-up fetch, which is
+	// only useful for diagnosing a specific historical window.
+	Until time.Duration
+}
+
+func NewEventSupervisor(client *docker.Client, since, until time.Duration) *EventSupervisor {
+	return &EventSupervisor{client: client, Since: since, Until: until}
+}
+
+// Run blocks forever, handling events until the process is killed. It
+// never returns via log.Fatalln the way the old monitorEvents loop did;
+// a closed channel is just another reason to reconnect.
+func (s *EventSupervisor) Run() {
+	backoff := backoffBase
+
+	for {
+		events := make(chan *docker.APIEvents, 32)
+
+		opts := docker.EventsOptions{
+			// Restrict to container events so the channel isn't flooded
+			// with image pulls, network/volume churn, etc. we never act
+			// on anyway.
+			Filters: map[string][]string{"type": {"container"}},
+		}
+		if s.Since > 0 {
+			opts.Since = fmt.Sprintf("%d", time.Now().Add(-s.Since).Unix())
+		}
+		if s.Until > 0 {
+			opts.Until = fmt.Sprintf("%d", time.Now().Add(-s.Until).Unix())
+		}
+
+		if err := s.client.AddEventListenerWithOptions(opts, events); err != nil {
+			log.Println("events: failed to register listener:", err)
+			backoff = s.sleep(backoff)
+			continue
+		}
+
+		log.Println("events: listening")
+		backoff = backoffBase
+
+		s.resync()
+
+		s.drain(events)
+
+		s.client.RemoveEventListener(events)
+		log.Println("events: stream closed, reconnecting")
+		backoff = s.sleep(backoff)
+	}
+}
+
+// drain consumes events until the channel is closed by go-dockerclient,
+// which is how it signals the underlying connection dropped.
+func (s *EventSupervisor) drain(events chan *docker.APIEvents) {
+	for event := range events {
+		handleEvent(event)
+	}
+}
+
+// resync inspects every supervised container and hands any that aren't
+// running to scheduleRestart, the same path a die event takes, covering
+// the window where the supervisor was disconnected from the event stream
+// and could have missed a die.
+func (s *EventSupervisor) resync() {
+	for name, entry := range confStore.Copy() {
+		entry.mu.Lock()
+		id := entry.ID
+		entry.mu.Unlock()
+
+		if id == "" {
+			continue
+		}
+
+		container, err := s.client.InspectContainer(id)
+		if err != nil {
+			log.Println("resync: unable to inspect", name, err)
+			continue
+		}
+
+		if !container.State.Running {
+			log.Println("resync: found stopped container, recreating:", name)
+			scheduleRestart(container.ID)
+		}
+	}
+}
+
+func (s *EventSupervisor) sleep(prev time.Duration) time.Duration {
+	time.Sleep(jitter(prev))
+
+	next := prev * 2
+	if next > backoffCap {
+		next = backoffCap
+	}
+	return next
+}
+
+// jitter returns a random duration in [d/2, d], so a daemon restart
+// doesn't cause every listener in a fleet to reconnect in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,67 @@
+package main
+
+import "log"
+
+// Values for Entry.OnUnhealthy.
+const (
+	OnUnhealthyIgnore  = "ignore"
+	OnUnhealthyRestart = "restart"
+)
+
+func effectiveOnUnhealthy(entry *Entry) string {
+	if entry.OnUnhealthy == "" {
+		return OnUnhealthyIgnore
+	}
+	return entry.OnUnhealthy
+}
+
+// handleHealthStatus reacts to a health_status event for id, debouncing
+// consecutive "unhealthy" transitions before triggering a recreate so a
+// container that flaps in and out of the health check doesn't get
+// restarted on every single check.
+func handleHealthStatus(id, status string) {
+	container, err := client.InspectContainer(id)
+	if err != nil {
+		return
+	}
+
+	name := containerName(container)
+
+	entry, ok := confStore.Get(name)
+	if !ok {
+		return
+	}
+
+	entry.mu.Lock()
+
+	if status != "unhealthy" {
+		entry.consecutiveUnhealthy = 0
+		entry.mu.Unlock()
+		return
+	}
+
+	if effectiveOnUnhealthy(entry) != OnUnhealthyRestart {
+		entry.mu.Unlock()
+		return
+	}
+
+	entry.consecutiveUnhealthy++
+
+	threshold := entry.UnhealthyThreshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	if entry.consecutiveUnhealthy < threshold {
+		count := entry.consecutiveUnhealthy
+		entry.mu.Unlock()
+		log.Printf("health: %s unhealthy (%d/%d), waiting for debounce", name, count, threshold)
+		return
+	}
+
+	entry.consecutiveUnhealthy = 0
+	entry.mu.Unlock()
+
+	log.Printf("health: %s unhealthy %d time(s) in a row, recreating", name, threshold)
+	scheduleRestart(id)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/fsouza/go-dockerclient"
+)
+
+// labeled reports whether labels carries a truthy SuperviseLabel. Older
+// go-dockerclient releases still populate Labels on both docker.Container
+// and docker.APIContainers, but a nil map (or an old daemon that strips
+// labels) is handled the same as "not enrolled".
+func labeled(labels map[string]string) bool {
+	return labels != nil && labels[SuperviseLabel] == "true"
+}
+
+// enrollOptionsFromLabels derives EnrollOptions from a container's
+// supervise.* labels, degrading to the defaults when they're absent.
+func enrollOptionsFromLabels(labels map[string]string) EnrollOptions {
+	policy, maxRetryCount := parsePolicyLabel(labels[SupervisePolicyLabel])
+	return EnrollOptions{
+		Policy:        policy,
+		MaxRetryCount: maxRetryCount,
+		OnUnhealthy:   labels[SuperviseUnhealthyLabel],
+	}
+}
+
+// seedLabeled lists every running-or-not container carrying SuperviseLabel
+// and enrolls it as a read-only entry, so a supervisor restart doesn't
+// forget about label-driven containers.
+func seedLabeled() error {
+	containers, err := client.ListContainers(docker.ListContainersOptions{
+		All: true,
+		Filters: map[string][]string{
+			"label": {SuperviseLabel + "=true"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		if !labeled(c.Labels) {
+			// Some daemons ignore unknown filters instead of erroring;
+			// double check locally so we don't trust the filter blindly.
+			continue
+		}
+
+		container, err := client.InspectContainer(c.ID)
+		if err != nil {
+			continue
+		}
+
+		name := containerName(container)
+		if _, ok := confStore.Get(name); !ok {
+			confStore.AddLabeled(container, enrollOptionsFromLabels(c.Labels))
+		}
+	}
+
+	return nil
+}
+
+// syncLabeled keeps the store in sync with a single container's current
+// label state in response to a start/rename event.
+func syncLabeled(id string) {
+	container, err := client.InspectContainer(id)
+	if err != nil {
+		// The container is already gone; destroy handles that case via
+		// ConfigStore.FindByID instead, since it can't be inspected.
+		return
+	}
+
+	name := containerName(container)
+
+	// A rename leaves a stale entry behind under the old name.
+	if oldName, entry, ok := confStore.FindByID(id); ok && oldName != name && entry.ReadOnly {
+		confStore.Remove(oldName)
+	}
+
+	entry, tracked := confStore.Get(name)
+	switch {
+	case labeled(container.Config.Labels) && !tracked:
+		confStore.AddLabeled(container, enrollOptionsFromLabels(container.Config.Labels))
+	case !labeled(container.Config.Labels) && tracked && entry.ReadOnly:
+		confStore.Remove(name)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/cobjet-docker/docker-supervise/apierr"
+	"github.com/fsouza/go-dockerclient"
+)
+
+// maxNonFollowLogBytes caps a non-follow GET /{name}/logs response so a
+// container with a huge log file can't be used to exhaust the
+// supervisor's own memory or the client's patience.
+const maxNonFollowLogBytes = 1 << 20 // 1MiB
+
+// handleLogs streams a supervised container's logs to rw as docker sends
+// them, leaving the stdout/stderr stdcopy framing of non-tty containers in
+// place rather than demuxing it.
+func handleLogs(rw http.ResponseWriter, r *http.Request, name string) {
+	entry, ok := confStore.Get(name)
+	if !ok {
+		writeError(rw, apierr.NotFound(errors.New("no such supervised container: "+name)))
+		return
+	}
+
+	entry.mu.Lock()
+	containerID := entry.ID
+	entry.mu.Unlock()
+
+	q := r.URL.Query()
+	follow := q.Get("follow") == "1" || q.Get("follow") == "true"
+
+	tail := q.Get("tail")
+	if tail == "" {
+		tail = "all"
+	}
+
+	var since int64
+	if s := q.Get("since"); s != "" {
+		since, _ = strconv.ParseInt(s, 10, 64)
+	}
+
+	rw.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+	rw.WriteHeader(http.StatusOK)
+
+	out := &flushWriter{w: rw, flusher: asFlusher(rw)}
+
+	var stdout, stderr io.Writer = out, out
+	if !follow {
+		capped := &limitedWriter{w: out, remaining: maxNonFollowLogBytes}
+		stdout, stderr = capped, capped
+	}
+
+	// RawTerminal is always true here, regardless of whether the
+	// container itself has a tty: it tells go-dockerclient to copy the
+	// daemon's bytes straight through instead of demuxing the
+	// stdout/stderr stdcopy framing first. For a tty container that's a
+	// no-op (there's no framing to strip); for a non-tty one it's what
+	// keeps the response body an actual vnd.docker.raw-stream -- the
+	// multiplexed frames the Content-Type above promises -- instead of
+	// silently handing back already-demuxed, unframed text.
+	err := client.Logs(docker.LogsOptions{
+		Context:      r.Context(),
+		Container:    containerID,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Stdout:       true,
+		Stderr:       true,
+		Follow:       follow,
+		Tail:         tail,
+		Since:        since,
+		RawTerminal:  true,
+	})
+	if err != nil && r.Context().Err() == nil {
+		log.Println("logs:", name, err)
+	}
+}
+
+// handleExec creates and runs an exec in a supervised container. With
+// Content-Type: application/vnd.docker.raw-stream the HTTP connection is
+// hijacked and wired straight to the exec's stdin/stdout/stderr;
+// otherwise output is buffered and the exit code returned as JSON.
+func handleExec(rw http.ResponseWriter, r *http.Request, name string) {
+	entry, ok := confStore.Get(name)
+	if !ok {
+		writeError(rw, apierr.NotFound(errors.New("no such supervised container: "+name)))
+		return
+	}
+
+	entry.mu.Lock()
+	containerID := entry.ID
+	entry.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		writeError(rw, apierr.InvalidParameter(err))
+		return
+	}
+
+	cmd := r.Form["cmd"]
+	if len(cmd) == 0 {
+		writeError(rw, apierr.InvalidParameter(errors.New("missing cmd")))
+		return
+	}
+
+	raw := r.Header.Get("Content-Type") == "application/vnd.docker.raw-stream"
+
+	exec, err := client.CreateExec(docker.CreateExecOptions{
+		Container:    containerID,
+		Cmd:          cmd,
+		Tty:          raw,
+		AttachStdin:  raw,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		writeError(rw, classifyDockerErr(err))
+		return
+	}
+
+	if raw {
+		hijackExec(rw, exec.ID)
+		return
+	}
+
+	bufferedExec(rw, exec.ID)
+}
+
+func hijackExec(rw http.ResponseWriter, execID string) {
+	hj, ok := rw.(http.Hijacker)
+	if !ok {
+		writeError(rw, apierr.Unavailable(errors.New("connection does not support hijacking")))
+		return
+	}
+
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		writeError(rw, apierr.Unavailable(err))
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprint(buf, "HTTP/1.1 200 OK\r\nContent-Type: application/vnd.docker.raw-stream\r\n\r\n")
+	buf.Flush()
+
+	waiter, err := client.StartExecNonBlocking(execID, docker.StartExecOptions{
+		Tty:          true,
+		RawTerminal:  true,
+		InputStream:  buf,
+		OutputStream: conn,
+		ErrorStream:  conn,
+	})
+	if err != nil {
+		log.Println("exec: unable to start:", err)
+		return
+	}
+
+	waiter.Wait()
+}
+
+func bufferedExec(rw http.ResponseWriter, execID string) {
+	var out bytes.Buffer
+
+	err := client.StartExec(execID, docker.StartExecOptions{
+		OutputStream: &out,
+		ErrorStream:  &out,
+	})
+	if err != nil {
+		writeError(rw, classifyDockerErr(err))
+		return
+	}
+
+	inspect, err := client.InspectExec(execID)
+	if err != nil {
+		writeError(rw, classifyDockerErr(err))
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(marshal(struct {
+		ExitCode int    `json:"exit_code"`
+		Output   string `json:"output"`
+	}{
+		ExitCode: inspect.ExitCode,
+		Output:   out.String(),
+	}))
+}
+
+// flushWriter flushes rw after every write, so a streaming `docker logs
+// -f` style response doesn't sit buffered until the handler returns.
+type flushWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if f.flusher != nil {
+		f.flusher.Flush()
+	}
+	return n, err
+}
+
+func asFlusher(rw http.ResponseWriter) http.Flusher {
+	f, _ := rw.(http.Flusher)
+	return f
+}
+
+// limitedWriter caps how many bytes a non-follow log response can write,
+// erroring out (which aborts the underlying io.Copy in client.Logs) once
+// the cap is hit rather than buffering or streaming unbounded output.
+type limitedWriter struct {
+	w         *flushWriter
+	remaining int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, errors.New("log response size cap reached")
+	}
+	if len(p) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.w.Write(p)
+	l.remaining -= n
+	return n, err
+}
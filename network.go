@@ -0,0 +1,27 @@
+package main
+
+import "github.com/fsouza/go-dockerclient"
+
+// endpointConfigs derives a NetworkingConfig-shaped endpoint map from a
+// live container's NetworkSettings, so a recreated container can be
+// reconnected to every network it was attached to with its aliases and
+// static IPAM assignment intact.
+func endpointConfigs(settings *docker.NetworkSettings) map[string]*docker.EndpointConfig {
+	if settings == nil {
+		return nil
+	}
+
+	out := make(map[string]*docker.EndpointConfig, len(settings.Networks))
+	for name, ep := range settings.Networks {
+		if ep == nil {
+			continue
+		}
+		out[name] = &docker.EndpointConfig{
+			IPAMConfig: ep.IPAMConfig,
+			Links:      ep.Links,
+			Aliases:    ep.Aliases,
+			NetworkID:  ep.NetworkID,
+		}
+	}
+	return out
+}
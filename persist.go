@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// schemaVersion is bumped whenever the on-disk Entry shape changes in a
+// way that Go's forward-compatible JSON decoding alone can't paper over
+// (e.g. a field whose absence should mean something other than its zero
+// value). Entries are wrapped in envelope so Load can tell an old file
+// from a current one and migrate it.
+const schemaVersion = 2
+
+// envelope is the versioned wrapper persisted to disk around an Entry.
+type envelope struct {
+	Version int    `json:"version"`
+	Entry   *Entry `json:"entry"`
+}
+
+// Persister is implemented by anything that can durably store and reload
+// the supervised set across process restarts.
+type Persister interface {
+	Save(name string, entry *Entry) error
+	Delete(name string) error
+	Load() (map[string]*Entry, error)
+}
+
+// DirectoryPersister persists one JSON file per supervised container in a
+// directory on disk.
+type DirectoryPersister string
+
+func (d DirectoryPersister) path(name string) string {
+	return filepath.Join(string(d), name+".json")
+}
+
+func (d DirectoryPersister) Save(name string, entry *Entry) error {
+	bytes, err := json.MarshalIndent(envelope{Version: schemaVersion, Entry: entry}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(d.path(name), bytes, 0644)
+}
+
+func (d DirectoryPersister) Delete(name string) error {
+	err := os.Remove(d.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (d DirectoryPersister) Load() (map[string]*Entry, error) {
+	files, err := ioutil.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*Entry)
+
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+
+		bytes, err := ioutil.ReadFile(filepath.Join(string(d), f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		name := f.Name()[:len(f.Name())-len(".json")]
+
+		entry, version, err := decodeEntry(bytes)
+		if err != nil {
+			return nil, err
+		}
+		entries[name] = entry
+
+		if version < schemaVersion {
+			// Rewrite in the current schema so this file only needs
+			// migrating once.
+			if err := d.Save(name, entry); err != nil {
+				log.Printf("[warn] failed to migrate %s to schema v%d: %v", name, schemaVersion, err)
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// decodeEntry unmarshals one persisted file, tolerating the pre-envelope
+// schema (v1: a bare Entry, no version wrapper) alongside the current one.
+func decodeEntry(bytes []byte) (*Entry, int, error) {
+	var env envelope
+	if err := json.Unmarshal(bytes, &env); err == nil && env.Entry != nil {
+		return env.Entry, env.Version, nil
+	}
+
+	entry := &Entry{}
+	if err := json.Unmarshal(bytes, entry); err != nil {
+		return nil, 0, err
+	}
+	return entry, 1, nil
+}
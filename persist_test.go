@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestDecodeEntryCurrentSchema(t *testing.T) {
+	raw := []byte(`{"version":2,"entry":{"ID":"abc123","Policy":"on-failure"}}`)
+
+	entry, version, err := decodeEntry(raw)
+	if err != nil {
+		t.Fatalf("decodeEntry returned error: %v", err)
+	}
+	if version != 2 {
+		t.Errorf("version = %d, want 2", version)
+	}
+	if entry.ID != "abc123" || entry.Policy != "on-failure" {
+		t.Errorf("entry = %+v, want ID=abc123 Policy=on-failure", entry)
+	}
+}
+
+func TestDecodeEntryPreEnvelopeSchema(t *testing.T) {
+	raw := []byte(`{"ID":"abc123","Policy":"unless-stopped"}`)
+
+	entry, version, err := decodeEntry(raw)
+	if err != nil {
+		t.Fatalf("decodeEntry returned error: %v", err)
+	}
+	if version != 1 {
+		t.Errorf("version = %d, want 1 for a bare pre-envelope Entry", version)
+	}
+	if entry.ID != "abc123" || entry.Policy != "unless-stopped" {
+		t.Errorf("entry = %+v, want ID=abc123 Policy=unless-stopped", entry)
+	}
+}
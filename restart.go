@@ -0,0 +1,164 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Restart policies, named after the ones the docker daemon itself
+// understands.
+const (
+	RestartAlways        = "always"
+	RestartOnFailure     = "on-failure"
+	RestartUnlessStopped = "unless-stopped"
+
+	restartBackoffBase = time.Second
+	restartBackoffCap  = 2 * time.Minute
+
+	// stabilityWindow is how long a container has to stay up before a
+	// restart is considered to have "succeeded" and FailureCount resets,
+	// mirroring how the docker daemon judges its own restart policies.
+	stabilityWindow = 30 * time.Second
+)
+
+// RestartState is the crash-loop backoff bookkeeping scheduleRestart()
+// consults and updates every time a supervised container dies; recreate()
+// records LastStartedAt and resets it after the stability window.
+type RestartState struct {
+	FailureCount   int
+	LastStartedAt  time.Time
+	NextEligibleAt time.Time
+	lastBackoff    time.Duration
+}
+
+func effectivePolicy(entry *Entry) string {
+	if entry.Policy == "" {
+		return RestartAlways
+	}
+	return entry.Policy
+}
+
+// parsePolicyLabel splits a supervise.policy label value such as
+// "on-failure:5" into a policy name and an optional retry count.
+func parsePolicyLabel(value string) (policy string, maxRetryCount int) {
+	if value == "" {
+		return RestartAlways, 0
+	}
+
+	parts := strings.SplitN(value, ":", 2)
+	policy = parts[0]
+
+	if len(parts) == 2 {
+		if n, err := strconv.Atoi(parts[1]); err == nil {
+			maxRetryCount = n
+		}
+	}
+
+	return policy, maxRetryCount
+}
+
+// shouldRestart decides whether a died container should be recreated,
+// and bumps FailureCount as a side effect since every call represents
+// one more consecutive failure to weigh against MaxRetryCount.
+//
+// A clean exit (no error code, not OOM-killed) means the container was
+// stopped deliberately, e.g. via `docker stop` --
+// every policy, including the RestartAlways default, leaves it stopped
+// rather than forcing it back up, matching the docker daemon's own
+// "always" policy.
+func shouldRestart(name string, entry *Entry, container *docker.Container) bool {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	cleanExit := container.State.ExitCode == 0 && !container.State.OOMKilled
+	policy := effectivePolicy(entry)
+
+	if cleanExit {
+		if policy == RestartOnFailure {
+			entry.Restart.FailureCount = 0
+		}
+		return false
+	}
+
+	switch policy {
+	case RestartOnFailure:
+		entry.Restart.FailureCount++
+		if entry.MaxRetryCount > 0 && entry.Restart.FailureCount > entry.MaxRetryCount {
+			log.Printf("restart: %s exceeded max retry count (%d), leaving it stopped", name, entry.MaxRetryCount)
+			return false
+		}
+	default: // RestartUnlessStopped, RestartAlways
+		entry.Restart.FailureCount++
+	}
+
+	return true
+}
+
+// backoffFor returns how long to wait before the next restart attempt,
+// using decorrelated-jitter exponential backoff, and records the state
+// needed to compute the next one.
+func backoffFor(entry *Entry) time.Duration {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	prev := entry.Restart.lastBackoff
+	if prev == 0 {
+		prev = restartBackoffBase
+	}
+
+	lo := int64(restartBackoffBase)
+	hi := int64(prev) * 3
+	if hi <= lo {
+		hi = lo + 1
+	}
+
+	d := time.Duration(lo + rand.Int63n(hi-lo))
+	if d > restartBackoffCap {
+		d = restartBackoffCap
+	}
+
+	entry.Restart.lastBackoff = d
+	entry.Restart.NextEligibleAt = time.Now().Add(d)
+
+	return d
+}
+
+// scheduleRestart is what die events and resync funnel into: it decides,
+// per the entry's restart policy, whether id's container should come
+// back, and if so recreates it after an appropriate backoff.
+func scheduleRestart(id string) {
+	container, err := client.InspectContainer(id)
+	if err != nil {
+		log.Println("restart: container destroyed too quickly, skipping", id)
+		return
+	}
+
+	name := containerName(container)
+
+	entry, ok := confStore.Get(name)
+	if !ok {
+		return
+	}
+
+	if !shouldRestart(name, entry, container) {
+		return
+	}
+
+	delay := backoffFor(entry)
+	if delay <= 0 {
+		recreate(id)
+		return
+	}
+
+	entry.mu.Lock()
+	failureCount := entry.Restart.FailureCount
+	entry.mu.Unlock()
+
+	log.Printf("restart: %s backing off %s before recreate (failure #%d)", name, delay, failureCount)
+	time.AfterFunc(delay, func() { recreate(id) })
+}
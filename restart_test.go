@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+func TestParsePolicyLabel(t *testing.T) {
+	cases := []struct {
+		value        string
+		wantPolicy   string
+		wantMaxRetry int
+	}{
+		{"", RestartAlways, 0},
+		{"always", "always", 0},
+		{"on-failure", "on-failure", 0},
+		{"on-failure:5", "on-failure", 5},
+		{"on-failure:bogus", "on-failure", 0},
+	}
+
+	for _, c := range cases {
+		policy, maxRetry := parsePolicyLabel(c.value)
+		if policy != c.wantPolicy || maxRetry != c.wantMaxRetry {
+			t.Errorf("parsePolicyLabel(%q) = (%q, %d), want (%q, %d)", c.value, policy, maxRetry, c.wantPolicy, c.wantMaxRetry)
+		}
+	}
+}
+
+func TestBackoffForStaysWithinBounds(t *testing.T) {
+	entry := &Entry{}
+
+	for i := 0; i < 20; i++ {
+		d := backoffFor(entry)
+		if d < restartBackoffBase || d > restartBackoffCap {
+			t.Fatalf("backoffFor returned %s, want within [%s, %s]", d, restartBackoffBase, restartBackoffCap)
+		}
+		if entry.Restart.NextEligibleAt.Before(time.Now()) {
+			t.Fatalf("NextEligibleAt not advanced into the future")
+		}
+	}
+}
+
+func containerWithExit(exitCode int, oomKilled bool) *docker.Container {
+	return &docker.Container{
+		State: docker.State{
+			ExitCode:  exitCode,
+			OOMKilled: oomKilled,
+		},
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	cases := []struct {
+		name      string
+		entry     *Entry
+		container *docker.Container
+		want      bool
+	}{
+		{
+			name:      "always policy restarts on failure",
+			entry:     &Entry{},
+			container: containerWithExit(1, false),
+			want:      true,
+		},
+		{
+			name:      "always policy does not restart after clean stop",
+			entry:     &Entry{},
+			container: containerWithExit(0, false),
+			want:      false,
+		},
+		{
+			name:      "unless-stopped does not restart after clean stop",
+			entry:     &Entry{Policy: RestartUnlessStopped},
+			container: containerWithExit(0, false),
+			want:      false,
+		},
+		{
+			name:      "unless-stopped restarts on OOM kill even with exit 0",
+			entry:     &Entry{Policy: RestartUnlessStopped},
+			container: containerWithExit(0, true),
+			want:      true,
+		},
+		{
+			name:      "on-failure resets FailureCount and skips on clean exit",
+			entry:     &Entry{Policy: RestartOnFailure, Restart: RestartState{FailureCount: 3}},
+			container: containerWithExit(0, false),
+			want:      false,
+		},
+		{
+			name:      "on-failure stops once MaxRetryCount is exceeded",
+			entry:     &Entry{Policy: RestartOnFailure, MaxRetryCount: 1, Restart: RestartState{FailureCount: 1}},
+			container: containerWithExit(1, false),
+			want:      false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := shouldRestart("test", c.entry, c.container); got != c.want {
+				t.Errorf("shouldRestart() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestShouldRestartResetsFailureCountOnCleanExit(t *testing.T) {
+	entry := &Entry{Policy: RestartOnFailure, Restart: RestartState{FailureCount: 4}}
+	shouldRestart("test", entry, containerWithExit(0, false))
+
+	if entry.Restart.FailureCount != 0 {
+		t.Errorf("FailureCount = %d, want 0 after clean exit", entry.Restart.FailureCount)
+	}
+}
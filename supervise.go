@@ -2,11 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/cobjet-docker/docker-supervise/apierr"
 	"github.com/fsouza/go-dockerclient"
 )
 
@@ -26,6 +31,21 @@ func envopt(name, def string) string {
 	return def
 }
 
+// formInt parses the named form field as an int, treating a missing or
+// empty value as 0 (the EnrollOptions default) rather than an error.
+func formInt(form url.Values, name string) (int, error) {
+	raw := form.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.New("invalid " + name + ": " + raw)
+	}
+	return n, nil
+}
+
 func marshal(obj interface{}) []byte {
 	bytes, err := json.MarshalIndent(obj, "", "  ")
 	if err != nil {
@@ -34,6 +54,21 @@ func marshal(obj interface{}) []byte {
 	return bytes
 }
 
+// writeError maps err to a status code via apierr and writes it as a
+// {"message": "...", "code": "..."} JSON body, replacing the ad-hoc
+// http.Error(rw, err.Error(), ...) calls the handler used to make.
+func writeError(rw http.ResponseWriter, err error) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(apierr.StatusCode(err))
+	rw.Write(marshal(struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	}{
+		Message: err.Error(),
+		Code:    apierr.Code(err),
+	}))
+}
+
 func main() {
 	endpoint := envopt("DOCKER_HOST", "unix:///var/run/docker.sock")
 	port := envopt("PORT", "8080")
@@ -60,17 +95,27 @@ func main() {
 		log.Printf("[warn] failed to load from persist dir: %v", err)
 	}
 
-	events := make(chan *docker.APIEvents)
+	if err := seedLabeled(); err != nil {
+		log.Printf("[warn] failed to seed label-supervised containers: %v", err)
+	}
 
-	// go-dockerclient issue #101
-	client.AddEventListener(events)
-	client.RemoveEventListener(events)
-	err = client.AddEventListener(events)
-	if err != nil {
-		log.Fatalf("[fatal] failed to add event listener: %s\n", err)
+	resyncSince := time.Duration(0)
+	if window := envopt("EVENT_RESYNC_SINCE", ""); window != "" {
+		resyncSince, err = time.ParseDuration(window)
+		if err != nil {
+			log.Fatalf("[fatal] invalid EVENT_RESYNC_SINCE: %s\n", err)
+		}
+	}
+
+	resyncUntil := time.Duration(0)
+	if window := envopt("EVENT_RESYNC_UNTIL", ""); window != "" {
+		resyncUntil, err = time.ParseDuration(window)
+		if err != nil {
+			log.Fatalf("[fatal] invalid EVENT_RESYNC_UNTIL: %s\n", err)
+		}
 	}
 
-	go monitorEvents(events)
+	go NewEventSupervisor(client, resyncSince, resyncUntil).Run()
 
 	http.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
 		path := strings.Trim(r.URL.Path, "/")
@@ -85,13 +130,13 @@ func main() {
 				rw.Write(marshal(list))
 			case "POST":
 				if err := r.ParseForm(); err != nil {
-					http.Error(rw, err.Error(), http.StatusBadRequest)
+					writeError(rw, apierr.InvalidParameter(err))
 					return
 				}
 
 				name := strings.Trim(r.Form.Get("id"), "/")
 				if name == "" {
-					http.Error(rw, "Bad request", http.StatusBadRequest)
+					writeError(rw, apierr.InvalidParameter(errors.New("missing id")))
 					return
 				}
 
@@ -103,28 +148,90 @@ func main() {
 
 				container, err := client.InspectContainer(name)
 				if err != nil {
-					http.Error(rw, err.Error(), http.StatusBadRequest)
+					writeError(rw, classifyDockerErr(err))
+					return
+				}
+
+				maxRetryCount, err := formInt(r.Form, "max_retries")
+				if err != nil {
+					writeError(rw, apierr.InvalidParameter(err))
+					return
+				}
+
+				unhealthyThreshold, err := formInt(r.Form, "unhealthy_threshold")
+				if err != nil {
+					writeError(rw, apierr.InvalidParameter(err))
 					return
 				}
 
-				confStore.Add(strings.Trim(container.Name, "/"), container.Config)
+				confStore.Add(container, EnrollOptions{
+					Policy:             r.Form.Get("policy"),
+					MaxRetryCount:      maxRetryCount,
+					OnUnhealthy:        r.Form.Get("on_unhealthy"),
+					UnhealthyThreshold: unhealthyThreshold,
+				})
 
 				rw.Header().Set("Location", "/"+name)
 				rw.WriteHeader(http.StatusCreated)
 			default:
 				http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
 			}
+		} else if strings.HasSuffix(path, "/logs") {
+			name := strings.TrimSuffix(path, "/logs")
+			if _, ok := confStore.Get(name); !ok {
+				writeError(rw, apierr.NotFound(errors.New("no such supervised container: "+name)))
+				return
+			}
+			if r.Method != "GET" {
+				http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			handleLogs(rw, r, name)
+		} else if strings.HasSuffix(path, "/exec") {
+			name := strings.TrimSuffix(path, "/exec")
+			if _, ok := confStore.Get(name); !ok {
+				writeError(rw, apierr.NotFound(errors.New("no such supervised container: "+name)))
+				return
+			}
+			if r.Method != "POST" {
+				http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			handleExec(rw, r, name)
 		} else {
-			conf, ok := confStore.Get(path)
+			entry, ok := confStore.Get(path)
 			if !ok {
-				http.Error(rw, "Not found", http.StatusNotFound)
+				writeError(rw, apierr.NotFound(errors.New("no such supervised container: "+path)))
 				return
 			}
 
 			switch r.Method {
 			case "GET":
-				rw.Write(marshal(conf))
+				entry.mu.Lock()
+				resp := struct {
+					Config             *docker.Config
+					ReadOnly           bool
+					Policy             string
+					MaxRetryCount      int
+					OnUnhealthy        string
+					UnhealthyThreshold int
+					Restart            RestartState
+				}{
+					Config:             entry.Config,
+					ReadOnly:           entry.ReadOnly,
+					Policy:             effectivePolicy(entry),
+					MaxRetryCount:      entry.MaxRetryCount,
+					OnUnhealthy:        effectiveOnUnhealthy(entry),
+					UnhealthyThreshold: entry.UnhealthyThreshold,
+					Restart:            entry.Restart,
+				}
+				entry.mu.Unlock()
+				rw.Write(marshal(resp))
 			case "DELETE":
+				if entry.ReadOnly {
+					writeError(rw, apierr.Conflict(errors.New("container is supervised via "+SuperviseLabel+", remove the label instead")))
+					return
+				}
 				confStore.Remove(path)
 			default:
 				http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
@@ -134,41 +241,113 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
-func monitorEvents(c chan *docker.APIEvents) {
-	for event := range c {
-		if event.Status == "die" {
-			container, err := client.InspectContainer(event.ID)
-			if err != nil {
-				log.Println("monitor: container destroyed too quickly, skipping", event.ID)
-				continue
-			}
+// handleEvent applies a single docker event to the supervised set. It is
+// called from EventSupervisor for every event delivered on the current
+// listener, across however many reconnects that takes.
+func handleEvent(event *docker.APIEvents) {
+	switch eventAction(event) {
+	case "die":
+		scheduleRestart(event.ID)
+	case "start":
+		syncLabeled(event.ID)
+	case "destroy":
+		if name, entry, ok := confStore.FindByID(event.ID); ok && entry.ReadOnly {
+			confStore.Remove(name)
+		}
+	case "rename":
+		syncLabeled(event.ID)
+	case "health_status":
+		handleHealthStatus(event.ID, eventHealthStatus(event))
+	}
+}
 
-			name := container.Name[1:]
+// recreate removes and recreates the named container from its last
+// persisted Config, HostConfig and network attachments, then starts it
+// back up. This is what a "die" event, and a failed resync, both funnel
+// into. Unlike the original implementation, it never depends on the live
+// container still existing beyond the InspectContainer it starts with: everything it
+// needs to rebuild came from the ConfigStore, so a supervisor restart
+// between the die and the recreate can't lose port bindings or networks.
+func recreate(id string) {
+	container, err := client.InspectContainer(id)
+	if err != nil {
+		log.Println("monitor: container destroyed too quickly, skipping", id)
+		return
+	}
 
-			conf, ok := confStore.Get(name)
-			if !ok {
-				continue
-			}
+	name := containerName(container)
 
-			hostConfig := container.HostConfig
+	entry, ok := confStore.Get(name)
+	if !ok {
+		return
+	}
 
-			if err := client.RemoveContainer(docker.RemoveContainerOptions{ID: container.ID}); err != nil {
-				log.Println("monitor: unable to remove container:", err)
-			}
+	if err := client.RemoveContainer(docker.RemoveContainerOptions{ID: container.ID}); err != nil {
+		log.Println("monitor: unable to remove container:", err)
+	}
 
-			newContainer, err := client.CreateContainer(docker.CreateContainerOptions{
-				Name:   name,
-				Config: conf,
-			})
-			if err != nil {
-				log.Println("monitor: unable to create container:", err)
-				continue
-			}
+	createOpts := docker.CreateContainerOptions{
+		Name:       name,
+		Config:     entry.Config,
+		HostConfig: entry.HostConfig,
+	}
 
-			if err := client.StartContainer(newContainer.ID, hostConfig); err != nil {
-				log.Println("monitor: unable to start container:", err)
-			}
+	// Only one network can be attached at creation time; the rest are
+	// joined afterwards via ConnectNetwork so their aliases and IPAM
+	// assignments aren't dropped.
+	extra := make(map[string]*docker.EndpointConfig, len(entry.Networks))
+	for netName, cfg := range entry.Networks {
+		extra[netName] = cfg
+	}
+	for netName, cfg := range extra {
+		createOpts.NetworkingConfig = &docker.NetworkingConfig{
+			EndpointsConfig: map[string]*docker.EndpointConfig{netName: cfg},
 		}
+		delete(extra, netName)
+		break
+	}
+
+	newContainer, err := client.CreateContainer(createOpts)
+	if err != nil {
+		log.Println("monitor: unable to create container:", err)
+		return
 	}
-	log.Fatalln("[fatal] monitor loop closed unexpectedly")
+
+	entry.mu.Lock()
+	entry.ID = newContainer.ID
+	entry.mu.Unlock()
+
+	for netName, cfg := range extra {
+		if err := client.ConnectNetwork(netName, docker.NetworkConnectionOptions{
+			Container:      newContainer.ID,
+			EndpointConfig: cfg,
+		}); err != nil {
+			log.Println("monitor: unable to connect network", netName, err)
+		}
+	}
+
+	if err := client.StartContainer(newContainer.ID, entry.HostConfig); err != nil {
+		log.Println("monitor: unable to start container:", err)
+		return
+	}
+
+	entry.mu.Lock()
+	entry.Restart.LastStartedAt = time.Now()
+	entry.mu.Unlock()
+
+	// If it's still running after the stability window, the restart
+	// "succeeded" and the crash-loop backoff resets to its starting
+	// point, matching how the docker daemon itself judges its own
+	// restart policies.
+	startedID := newContainer.ID
+	time.AfterFunc(stabilityWindow, func() {
+		c, err := client.InspectContainer(startedID)
+		if err == nil && c.State.Running {
+			entry.mu.Lock()
+			entry.Restart.FailureCount = 0
+			entry.Restart.lastBackoff = 0
+			entry.Restart.NextEligibleAt = time.Time{}
+			entry.mu.Unlock()
+		}
+	})
 }